@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+)
+
+// Backend abstracts the container runtime a node is driven through, so the
+// rest of the server can talk to Docker or Podman interchangeably.
+type Backend interface {
+	Create(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, name string) (string, error)
+	Start(ctx context.Context, containerID string) error
+	Stop(ctx context.Context, containerID string, options container.StopOptions) error
+	Update(ctx context.Context, containerID string, updateConfig container.UpdateConfig) error
+	Inspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	List(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
+	Stats(ctx context.Context, containerID string, stream bool) (types.ContainerStats, error)
+	Remove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error
+	Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error)
+	Restart(ctx context.Context, containerID string, options container.StopOptions) error
+	Pause(ctx context.Context, containerID string) error
+	Unpause(ctx context.Context, containerID string) error
+	BuildImage(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error)
+	PullImage(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error)
+	ListImages(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error)
+}
+
+// dockerBackend drives a container runtime through the stock Docker Engine
+// API. Podman's libpod REST API is Docker-compatible, so podmanBackend
+// simply reuses it against a different socket.
+type dockerBackend struct {
+	cli *client.Client
+}
+
+func (b *dockerBackend) Create(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, name string) (string, error) {
+	resp, err := b.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, name)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (b *dockerBackend) Start(ctx context.Context, containerID string) error {
+	return b.cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{})
+}
+
+func (b *dockerBackend) Stop(ctx context.Context, containerID string, options container.StopOptions) error {
+	return b.cli.ContainerStop(ctx, containerID, options)
+}
+
+func (b *dockerBackend) Update(ctx context.Context, containerID string, updateConfig container.UpdateConfig) error {
+	_, err := b.cli.ContainerUpdate(ctx, containerID, updateConfig)
+	return err
+}
+
+func (b *dockerBackend) Inspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	return b.cli.ContainerInspect(ctx, containerID)
+}
+
+func (b *dockerBackend) List(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	return b.cli.ContainerList(ctx, options)
+}
+
+func (b *dockerBackend) Stats(ctx context.Context, containerID string, stream bool) (types.ContainerStats, error) {
+	return b.cli.ContainerStats(ctx, containerID, stream)
+}
+
+func (b *dockerBackend) Remove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	return b.cli.ContainerRemove(ctx, containerID, options)
+}
+
+func (b *dockerBackend) Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error) {
+	return b.cli.Events(ctx, options)
+}
+
+func (b *dockerBackend) Restart(ctx context.Context, containerID string, options container.StopOptions) error {
+	return b.cli.ContainerRestart(ctx, containerID, options)
+}
+
+func (b *dockerBackend) Pause(ctx context.Context, containerID string) error {
+	return b.cli.ContainerPause(ctx, containerID)
+}
+
+func (b *dockerBackend) Unpause(ctx context.Context, containerID string) error {
+	return b.cli.ContainerUnpause(ctx, containerID)
+}
+
+func (b *dockerBackend) BuildImage(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+	return b.cli.ImageBuild(ctx, buildContext, options)
+}
+
+func (b *dockerBackend) PullImage(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	return b.cli.ImagePull(ctx, ref, options)
+}
+
+func (b *dockerBackend) ListImages(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	return b.cli.ImageList(ctx, options)
+}
+
+// podmanBackend talks to Podman's Docker-compatible libpod REST API over
+// its unix socket. The wire protocol is the same as Docker's, so it simply
+// embeds dockerBackend and differs only in which socket it dials.
+type podmanBackend struct {
+	dockerBackend
+}
+
+const defaultPodmanSocket = "unix:///run/podman/podman.sock"
+
+// backendKind selects which container runtime newly registered nodes are
+// driven through. It is set once in main() from a flag or the
+// CONTAINER_BACKEND env var.
+var backendKind = backendKindFromEnv()
+
+func backendKindFromEnv() string {
+	if kind := os.Getenv("CONTAINER_BACKEND"); kind != "" {
+		return kind
+	}
+	return "docker"
+}
+
+var backendFlag = flag.String("container-backend", "", "container backend to use for newly registered nodes: docker or podman (defaults to $CONTAINER_BACKEND, then docker)")
+
+// newBackend dials endpoint with the configured backend's client options.
+// An empty endpoint falls back to the backend's default local socket.
+func newBackend(endpoint string, opts ...client.Opt) (Backend, error) {
+	switch backendKind {
+	case "podman":
+		if endpoint == "" {
+			endpoint = defaultPodmanSocket
+		}
+		cli, err := client.NewClientWithOpts(append([]client.Opt{client.WithHost(endpoint)}, opts...)...)
+		if err != nil {
+			return nil, err
+		}
+		return &podmanBackend{dockerBackend{cli: cli}}, nil
+	default:
+		if endpoint == "" {
+			endpoint = client.DefaultDockerHost
+		}
+		cli, err := client.NewClientWithOpts(append([]client.Opt{client.WithHost(endpoint)}, opts...)...)
+		if err != nil {
+			return nil, err
+		}
+		return &dockerBackend{cli: cli}, nil
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/gorilla/mux"
+)
+
+// Node describes a single Docker host under management.
+type Node struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Endpoint    string `json:"endpoint"`
+	TLSCertPath string `json:"tls_cert_path,omitempty"`
+	TLSKeyPath  string `json:"tls_key_path,omitempty"`
+	TLSCAPath   string `json:"tls_ca_path,omitempty"`
+	TotalRAM    int64  `json:"total_ram"`
+	TotalCPU    int64  `json:"total_cpu"`
+	UsedRAM     int64  `json:"used_ram"`
+	UsedCPU     int64  `json:"used_cpu"`
+}
+
+func (n *Node) freeRAM() int64 {
+	return n.TotalRAM - n.UsedRAM
+}
+
+type reservation struct {
+	ram, cpu int64
+}
+
+// NodePool tracks registered nodes, their container backends, and which
+// node is currently running each container.
+type NodePool struct {
+	mu            sync.Mutex
+	nextID        int
+	nodes         map[string]*Node
+	backends      map[string]Backend
+	containerNode map[string]string
+	reservations  map[string]reservation
+}
+
+func NewNodePool() *NodePool {
+	return &NodePool{
+		nodes:         make(map[string]*Node),
+		backends:      make(map[string]Backend),
+		containerNode: make(map[string]string),
+		reservations:  make(map[string]reservation),
+	}
+}
+
+func (p *NodePool) newNodeBackend(node *Node) (Backend, error) {
+	opts := []client.Opt{client.WithAPIVersionNegotiation()}
+
+	if node.TLSCertPath != "" && node.TLSKeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(node.TLSCertPath, node.TLSKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load node TLS material: %w", err)
+		}
+
+		tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+		if node.TLSCAPath != "" {
+			ca, err := os.ReadFile(node.TLSCAPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read node CA: %w", err)
+			}
+			pool := x509.NewCertPool()
+			pool.AppendCertsFromPEM(ca)
+			tlsConfig.RootCAs = pool
+		}
+
+		opts = append(opts, client.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		}))
+	}
+
+	return newBackend(node.Endpoint, opts...)
+}
+
+// RegisterNode dials the node's container backend and adds it to the pool.
+func (p *NodePool) RegisterNode(node *Node) (*Node, error) {
+	backend, err := p.newNodeBackend(node)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.nextID++
+	node.ID = fmt.Sprintf("node-%d", p.nextID)
+	p.nodes[node.ID] = node
+	p.backends[node.ID] = backend
+	p.mu.Unlock()
+
+	reconcilePortAllocator(node.ID, backend)
+	p.reconcileContainerNode(node.ID, backend)
+
+	return node, nil
+}
+
+// reconcileContainerNode rebuilds the containerNode/reservations bookkeeping
+// for containers that were already running on nodeID before it was
+// registered (an existing fleet being attached, or a manager restart),
+// mirroring reconcilePortAllocator's approach for ports. Containers already
+// bound to a node (e.g. ones created by this process) are left alone.
+func (p *NodePool) reconcileContainerNode(nodeID string, backend Backend) {
+	ctx := context.Background()
+
+	containers, err := backend.List(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		log.Println("Failed to reconcile container-node mapping:", err)
+		return
+	}
+
+	type reconciled struct {
+		id       string
+		ram, cpu int64
+	}
+
+	found := make([]reconciled, 0, len(containers))
+	for _, c := range containers {
+		var ram, cpu int64
+		if details, err := backend.Inspect(ctx, c.ID); err == nil && details.HostConfig != nil {
+			ram = details.HostConfig.Memory
+			cpu = details.HostConfig.NanoCPUs / 1e9
+		}
+		found = append(found, reconciled{id: c.ID, ram: ram, cpu: cpu})
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	node, ok := p.nodes[nodeID]
+	if !ok {
+		return
+	}
+
+	for _, c := range found {
+		if _, bound := p.containerNode[c.id]; bound {
+			continue
+		}
+		p.containerNode[c.id] = nodeID
+		p.reservations[c.id] = reservation{ram: c.ram, cpu: c.cpu}
+		node.UsedRAM += c.ram
+		node.UsedCPU += c.cpu
+	}
+}
+
+func (p *NodePool) RemoveNode(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.nodes[id]; !ok {
+		return errors.New("node not found")
+	}
+
+	delete(p.nodes, id)
+	delete(p.backends, id)
+	return nil
+}
+
+func (p *NodePool) ListNodes() []*Node {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	nodes := make([]*Node, 0, len(p.nodes))
+	for _, node := range p.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// Schedule picks a node for a new container using the given scheduler and
+// provisionally reserves ram/cpu against it, all under the pool's lock, so
+// two concurrent placements can't both land on the same capacity. The
+// reservation is confirmed by BindContainer once the container actually
+// starts, or given back via ReleaseCapacity if placement doesn't pan out.
+func (p *NodePool) Schedule(scheduler Scheduler, ram, cpu int64) (*Node, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.nodes) == 0 {
+		return nil, errors.New("no nodes registered")
+	}
+
+	nodes := make([]*Node, 0, len(p.nodes))
+	for _, node := range p.nodes {
+		nodes = append(nodes, node)
+	}
+
+	node, err := scheduler.SelectNode(nodes, ram, cpu)
+	if err != nil {
+		return nil, err
+	}
+
+	node.UsedRAM += ram
+	node.UsedCPU += cpu
+	return node, nil
+}
+
+// ReleaseCapacity gives back a reservation made by Schedule for a
+// placement that didn't end up running, e.g. because backend.Create or
+// backend.Start failed.
+func (p *NodePool) ReleaseCapacity(nodeID string, ram, cpu int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if node, ok := p.nodes[nodeID]; ok {
+		node.UsedRAM -= ram
+		node.UsedCPU -= cpu
+	}
+}
+
+// resolveNode picks the node identified by nodeID, or the sole registered
+// node when nodeID is empty and exactly one node is registered.
+func resolveNode(nodeID string) (*Node, error) {
+	nodes := nodePool.ListNodes()
+
+	if nodeID != "" {
+		for _, node := range nodes {
+			if node.ID == nodeID {
+				return node, nil
+			}
+		}
+		return nil, errors.New("node not found")
+	}
+
+	switch len(nodes) {
+	case 0:
+		return nil, errors.New("no nodes registered")
+	case 1:
+		return nodes[0], nil
+	default:
+		return nil, errors.New("multiple nodes registered; specify a node")
+	}
+}
+
+func (p *NodePool) BackendFor(nodeID string) (Backend, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	backend, ok := p.backends[nodeID]
+	if !ok {
+		return nil, errors.New("node not found")
+	}
+	return backend, nil
+}
+
+// BackendForContainer resolves the backend for whichever node is
+// currently running containerID.
+func (p *NodePool) BackendForContainer(containerID string) (Backend, error) {
+	p.mu.Lock()
+	nodeID, ok := p.containerNode[containerID]
+	p.mu.Unlock()
+
+	if !ok {
+		return nil, errors.New("container is not bound to any node")
+	}
+	return p.BackendFor(nodeID)
+}
+
+// BindContainer records that containerID is running on nodeID, confirming
+// the ram/cpu reservation Schedule already made against that node's
+// capacity. It does not touch node capacity itself; reconcileContainerNode,
+// which binds pre-existing containers without Schedule, updates the mapping
+// and capacity directly instead of calling this.
+func (p *NodePool) BindContainer(containerID, nodeID string, ram, cpu int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.containerNode[containerID] = nodeID
+	p.reservations[containerID] = reservation{ram: ram, cpu: cpu}
+}
+
+// UnbindContainer releases containerID's reserved capacity and forgets
+// which node it was running on. Call this once the container is removed.
+func (p *NodePool) UnbindContainer(containerID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	nodeID, ok := p.containerNode[containerID]
+	if !ok {
+		return
+	}
+
+	if res, ok := p.reservations[containerID]; ok {
+		if node, ok := p.nodes[nodeID]; ok {
+			node.UsedRAM -= res.ram
+			node.UsedCPU -= res.cpu
+		}
+	}
+
+	delete(p.containerNode, containerID)
+	delete(p.reservations, containerID)
+}
+
+// UpdateReservation adjusts containerID's reserved ram/cpu to match a
+// resize, applying the delta to its node's UsedRAM/UsedCPU so capacity
+// bookkeeping stays in sync with the container's real footprint.
+func (p *NodePool) UpdateReservation(containerID string, ram, cpu int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	nodeID, ok := p.containerNode[containerID]
+	if !ok {
+		return
+	}
+
+	old := p.reservations[containerID]
+	if node, ok := p.nodes[nodeID]; ok {
+		node.UsedRAM += ram - old.ram
+		node.UsedCPU += cpu - old.cpu
+	}
+	p.reservations[containerID] = reservation{ram: ram, cpu: cpu}
+}
+
+// Scheduler picks which node a new container should land on.
+type Scheduler interface {
+	SelectNode(nodes []*Node, ram, cpu int64) (*Node, error)
+}
+
+// SpreadScheduler favors the node with the most free RAM, spreading load
+// evenly across the cluster.
+type SpreadScheduler struct{}
+
+func (SpreadScheduler) SelectNode(nodes []*Node, ram, cpu int64) (*Node, error) {
+	var best *Node
+	for _, node := range nodes {
+		if node.freeRAM() < ram {
+			continue
+		}
+		if best == nil || node.freeRAM() > best.freeRAM() {
+			best = node
+		}
+	}
+	if best == nil {
+		return nil, errors.New("no node has enough free capacity")
+	}
+	return best, nil
+}
+
+// BinPackScheduler favors the node with the least free RAM that still has
+// room for the requested RAM, packing containers tightly before spilling
+// onto a new node.
+type BinPackScheduler struct{}
+
+func (BinPackScheduler) SelectNode(nodes []*Node, ram, cpu int64) (*Node, error) {
+	var best *Node
+	for _, node := range nodes {
+		if node.freeRAM() < ram {
+			continue
+		}
+		if best == nil || node.freeRAM() < best.freeRAM() {
+			best = node
+		}
+	}
+	if best == nil {
+		return nil, errors.New("no node has enough free capacity")
+	}
+	return best, nil
+}
+
+// RandomScheduler picks uniformly at random among nodes that fit.
+type RandomScheduler struct{}
+
+func (RandomScheduler) SelectNode(nodes []*Node, ram, cpu int64) (*Node, error) {
+	var candidates []*Node
+	for _, node := range nodes {
+		if node.freeRAM() >= ram {
+			candidates = append(candidates, node)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("no node has enough free capacity")
+	}
+	return candidates[rand.Intn(len(candidates))], nil
+}
+
+var nodePool = NewNodePool()
+
+var scheduler = newSchedulerFromEnv()
+
+func newSchedulerFromEnv() Scheduler {
+	switch os.Getenv("CLUSTER_SCHEDULER") {
+	case "spread":
+		return SpreadScheduler{}
+	case "random":
+		return RandomScheduler{}
+	default:
+		return BinPackScheduler{}
+	}
+}
+
+type registerNodeRequest struct {
+	Name        string `json:"name"`
+	Endpoint    string `json:"endpoint"`
+	TLSCertPath string `json:"tls_cert_path,omitempty"`
+	TLSKeyPath  string `json:"tls_key_path,omitempty"`
+	TLSCAPath   string `json:"tls_ca_path,omitempty"`
+	TotalRAM    int64  `json:"total_ram"`
+	TotalCPU    int64  `json:"total_cpu"`
+}
+
+func registerNode(w http.ResponseWriter, r *http.Request) {
+	var req registerNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" || req.Endpoint == "" {
+		http.Error(w, "name and endpoint are required", http.StatusBadRequest)
+		return
+	}
+
+	node := &Node{
+		Name:        req.Name,
+		Endpoint:    req.Endpoint,
+		TLSCertPath: req.TLSCertPath,
+		TLSKeyPath:  req.TLSKeyPath,
+		TLSCAPath:   req.TLSCAPath,
+		TotalRAM:    req.TotalRAM,
+		TotalCPU:    req.TotalCPU,
+	}
+
+	node, err := nodePool.RegisterNode(node)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	responseJSON, err := json.Marshal(node)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(responseJSON)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func listNodes(w http.ResponseWriter, r *http.Request) {
+	nodes := nodePool.ListNodes()
+
+	type nodeWithCapacity struct {
+		*Node
+		FreeRAM int64 `json:"free_ram"`
+	}
+
+	response := make([]nodeWithCapacity, 0, len(nodes))
+	for _, node := range nodes {
+		response = append(response, nodeWithCapacity{Node: node, FreeRAM: node.freeRAM()})
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(responseJSON)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func deleteNode(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	nodeID := params["id"]
+
+	if err := nodePool.RemoveNode(nodeID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
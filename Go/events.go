@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+const eventsKeepaliveInterval = 15 * time.Second
+
+// nodeEvent tags a Docker event with the node it came from, so a cluster
+// client can tell which daemon reported it.
+type nodeEvent struct {
+	NodeID string `json:"node_id"`
+	events.Message
+}
+
+func buildEventFilters(query map[string][]string) filters.Args {
+	args := filters.NewArgs()
+
+	if eventType := firstQueryValue(query, "type"); eventType != "" {
+		args.Add("type", eventType)
+	}
+
+	for _, action := range strings.Split(firstQueryValue(query, "event"), ",") {
+		if action != "" {
+			args.Add("event", action)
+		}
+	}
+
+	return args
+}
+
+func firstQueryValue(query map[string][]string, key string) string {
+	values := query[key]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// streamEvents fans Docker events in from every registered node and
+// rewrites them as a single Server-Sent Events stream.
+func streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	nodes := nodePool.ListNodes()
+	if len(nodes) == 0 {
+		http.Error(w, "No nodes registered", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	options := types.EventsOptions{
+		Filters: buildEventFilters(query),
+		Since:   firstQueryValue(query, "since"),
+		Until:   firstQueryValue(query, "until"),
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	merged := make(chan nodeEvent)
+	var wg sync.WaitGroup
+
+	for _, node := range nodes {
+		backend, err := nodePool.BackendFor(node.ID)
+		if err != nil {
+			continue
+		}
+
+		msgCh, errCh := backend.Events(ctx, options)
+
+		wg.Add(1)
+		go func(nodeID string) {
+			defer wg.Done()
+			for {
+				select {
+				case msg, ok := <-msgCh:
+					if !ok {
+						return
+					}
+					select {
+					case merged <- nodeEvent{NodeID: nodeID, Message: msg}:
+					case <-ctx.Done():
+						return
+					}
+				case err, ok := <-errCh:
+					if ok && err != nil {
+						log.Println("Event stream error for node", nodeID, ":", err)
+					}
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(node.ID)
+	}
+
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(eventsKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-merged:
+			if !ok {
+				return
+			}
+
+			payload, err := json.Marshal(evt)
+			if err != nil {
+				log.Println("Failed to marshal event:", err)
+				continue
+			}
+
+			fmt.Fprintf(w, "event: container.%s\ndata: %s\n\n", evt.Action, payload)
+			flusher.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/docker/docker/api/types"
+)
+
+const maxBuildContextMemory = 32 << 20 // 32 MB held in memory before spilling to disk
+
+// streamDockerOutput copies a Docker SDK response body to w one JSON line
+// at a time, flushing after every line so the client sees progress live.
+func streamDockerOutput(w http.ResponseWriter, body io.Reader) {
+	flusher, ok := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		if _, err := w.Write(append(scanner.Bytes(), '\n')); err != nil {
+			log.Println("Failed to write build/pull output:", err)
+			return
+		}
+		if ok {
+			flusher.Flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Println("Error reading build/pull output:", err)
+	}
+}
+
+func buildImage(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxBuildContextMemory); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	tag := r.FormValue("t")
+	if tag == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "t (image tag) is required")
+		return
+	}
+
+	buildContext, _, err := r.FormFile("context")
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "context (tar build context) is required")
+		return
+	}
+	defer buildContext.Close()
+
+	node, err := resolveNode(r.FormValue("node"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	backend, err := nodePool.BackendFor(node.ID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp, err := backend.BuildImage(context.Background(), buildContext, types.ImageBuildOptions{
+		Tags: []string{tag},
+	})
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	streamDockerOutput(w, resp.Body)
+}
+
+func pullImage(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	image := r.FormValue("image")
+	if image == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "image is required")
+		return
+	}
+
+	node, err := resolveNode(r.FormValue("node"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	backend, err := nodePool.BackendFor(node.ID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	body, err := backend.PullImage(context.Background(), image, types.ImagePullOptions{})
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer body.Close()
+
+	streamDockerOutput(w, body)
+}
+
+func listImages(w http.ResponseWriter, r *http.Request) {
+	node, err := resolveNode(r.URL.Query().Get("node"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	backend, err := nodePool.BackendFor(node.ID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	images, err := backend.ListImages(context.Background(), types.ImageListOptions{})
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	responseJSON, err := json.Marshal(images)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(responseJSON); err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	defaultPortRangeStart = 30000
+	defaultPortRangeEnd   = 32767
+
+	// hostPortLabel is stamped onto every auto-provisioned container so the
+	// allocator can rebuild its state from cli.ContainerList after a restart.
+	hostPortLabel = "cluster.hostPort"
+)
+
+// PortAllocator hands out free host ports from a fixed range, à la
+// Kubernetes NodePorts, and can be reconciled against containers that
+// already hold a port via their cluster.hostPort label.
+type PortAllocator struct {
+	mu         sync.Mutex
+	start, end int
+	allocated  map[int]bool
+}
+
+func NewPortAllocator(start, end int) *PortAllocator {
+	return &PortAllocator{
+		start:     start,
+		end:       end,
+		allocated: make(map[int]bool),
+	}
+}
+
+func portRangeFromEnv() (int, int) {
+	start := defaultPortRangeStart
+	end := defaultPortRangeEnd
+
+	if v, err := strconv.Atoi(os.Getenv("CLUSTER_PORT_RANGE_START")); err == nil {
+		start = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("CLUSTER_PORT_RANGE_END")); err == nil {
+		end = v
+	}
+
+	return start, end
+}
+
+// Reserve marks port as in use, returning false if it was already
+// reserved.
+func (a *PortAllocator) Reserve(port int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.allocated[port] {
+		return false
+	}
+	a.allocated[port] = true
+	return true
+}
+
+// Allocate returns the next free port in the range.
+func (a *PortAllocator) Allocate() (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for port := a.start; port <= a.end; port++ {
+		if !a.allocated[port] {
+			a.allocated[port] = true
+			return port, nil
+		}
+	}
+
+	return 0, errors.New("no free host ports left in the reserved range")
+}
+
+// Release returns port to the pool.
+func (a *PortAllocator) Release(port int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.allocated, port)
+}
+
+// PortAllocatorPool hands each node its own PortAllocator. Host ports are a
+// per-daemon resource, so a port reserved on one node must not block the
+// same port number on another.
+type PortAllocatorPool struct {
+	mu         sync.Mutex
+	start, end int
+	allocators map[string]*PortAllocator
+}
+
+func NewPortAllocatorPool(start, end int) *PortAllocatorPool {
+	return &PortAllocatorPool{
+		start:      start,
+		end:        end,
+		allocators: make(map[string]*PortAllocator),
+	}
+}
+
+// For returns nodeID's allocator, creating one the first time nodeID is
+// seen.
+func (p *PortAllocatorPool) For(nodeID string) *PortAllocator {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	allocator, ok := p.allocators[nodeID]
+	if !ok {
+		allocator = NewPortAllocator(p.start, p.end)
+		p.allocators[nodeID] = allocator
+	}
+	return allocator
+}
+
+var portAllocators = newPortAllocatorPoolFromEnv()
+
+func newPortAllocatorPoolFromEnv() *PortAllocatorPool {
+	start, end := portRangeFromEnv()
+	return NewPortAllocatorPool(start, end)
+}
+
+// reconcilePortAllocator rebuilds nodeID's allocator state for ports that
+// were handed out before a restart by reading back each of its
+// containers' cluster.hostPort label.
+func reconcilePortAllocator(nodeID string, backend Backend) {
+	containers, err := backend.List(context.Background(), types.ContainerListOptions{All: true})
+	if err != nil {
+		log.Println("Failed to reconcile port allocator:", err)
+		return
+	}
+
+	allocator := portAllocators.For(nodeID)
+
+	for _, c := range containers {
+		portStr, ok := c.Labels[hostPortLabel]
+		if !ok {
+			continue
+		}
+
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			continue
+		}
+
+		allocator.Reserve(port)
+	}
+}
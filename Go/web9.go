@@ -3,13 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 	"github.com/gorilla/mux"
 )
@@ -18,9 +20,24 @@ type ErrorResponse struct {
 	Message string `json:"message"`
 }
 
+func writeErrorResponse(w http.ResponseWriter, status int, message string) {
+	responseJSON, err := json.Marshal(ErrorResponse{Message: message})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(responseJSON); err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
 type Response struct {
 	ContainerID string `json:"container_id"`
 	IPAddress   string `json:"ip_address"`
+	HostPort    int    `json:"host_port"`
 }
 
 func createDockerContainer(w http.ResponseWriter, r *http.Request) {
@@ -43,51 +60,90 @@ func createDockerContainer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	hostPortStr := r.FormValue("hostPort")
-	hostPortInt, err := strconv.Atoi(hostPortStr)
+	var explicitPort int
+	if hostPortStr != "" {
+		explicitPort, err = strconv.Atoi(hostPortStr)
+		if err != nil {
+			http.Error(w, "Invalid input for host port", http.StatusBadRequest)
+			return
+		}
+	}
+
+	node, err := nodePool.Schedule(scheduler, ram, cpu)
 	if err != nil {
-		http.Error(w, "Invalid input for host port", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	backend, err := nodePool.BackendFor(node.ID)
 	if err != nil {
+		nodePool.ReleaseCapacity(node.ID, ram, cpu)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	ctx := context.Background()
+	portAllocator := portAllocators.For(node.ID)
 
-	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
-		All: true,
-	})
-	if err != nil {
-		http.Error(w, "Failed to list containers", http.StatusInternalServerError)
-		return
-	}
-	for _, container := range containers {
-		for _, port := range container.Ports {
-			if port.PublicPort == uint16(hostPortInt) {
-				errorResponse := ErrorResponse{
-					Message: "Port is already allocated",
-				}
-				responseJSON, err := json.Marshal(errorResponse)
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
+	var hostPort int
+	if hostPortStr != "" {
+		containers, err := backend.List(ctx, types.ContainerListOptions{
+			All: true,
+		})
+		if err != nil {
+			nodePool.ReleaseCapacity(node.ID, ram, cpu)
+			http.Error(w, "Failed to list containers", http.StatusInternalServerError)
+			return
+		}
+		for _, container := range containers {
+			for _, port := range container.Ports {
+				if port.PublicPort == uint16(explicitPort) {
+					nodePool.ReleaseCapacity(node.ID, ram, cpu)
+					errorResponse := ErrorResponse{
+						Message: "Port is already allocated",
+					}
+					responseJSON, err := json.Marshal(errorResponse)
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusInternalServerError)
+						return
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusBadRequest)
+					_, err = w.Write(responseJSON)
+					if err != nil {
+						log.Println("Failed to write response:", err)
+					}
 					return
 				}
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusBadRequest)
-				_, err = w.Write(responseJSON)
-				if err != nil {
-					log.Println("Failed to write response:", err)
-				}
-				return
 			}
 		}
+
+		if !portAllocator.Reserve(explicitPort) {
+			nodePool.ReleaseCapacity(node.ID, ram, cpu)
+			http.Error(w, "Port is already allocated", http.StatusBadRequest)
+			return
+		}
+		hostPort = explicitPort
+	} else {
+		hostPort, err = portAllocator.Allocate()
+		if err != nil {
+			nodePool.ReleaseCapacity(node.ID, ram, cpu)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	hostPortStr = strconv.Itoa(hostPort)
+
+	image := r.FormValue("image")
+	if image == "" {
+		image = "ombansod"
 	}
 
 	config := &container.Config{
-		Image: "ombansod", 
+		Image: image,
+		Labels: map[string]string{
+			hostPortLabel: hostPortStr,
+		},
 	}
 
 	hostConfig := &container.HostConfig{
@@ -106,26 +162,33 @@ func createDockerContainer(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	resp, err := cli.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	containerID, err := backend.Create(ctx, config, hostConfig, "")
 	if err != nil {
+		portAllocator.Release(hostPort)
+		nodePool.ReleaseCapacity(node.ID, ram, cpu)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+	if err := backend.Start(ctx, containerID); err != nil {
+		portAllocator.Release(hostPort)
+		nodePool.ReleaseCapacity(node.ID, ram, cpu)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	containerIP, err := getContainerIPAddress(resp.ID)
+	nodePool.BindContainer(containerID, node.ID, ram, cpu)
+
+	containerIP, err := getContainerIPAddress(containerID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	response := Response{
-		ContainerID: resp.ID,
+		ContainerID: containerID,
 		IPAddress:   containerIP,
+		HostPort:    hostPort,
 	}
 
 	responseJSON, err := json.Marshal(response)
@@ -146,15 +209,15 @@ func getContainerResources(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	containerID := params["id"]
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	backend, err := nodePool.BackendForContainer(containerID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
 	ctx := context.Background()
 
-	containerInfo, err := cli.ContainerInspect(ctx, containerID)
+	containerInfo, err := backend.Inspect(ctx, containerID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -206,9 +269,9 @@ func editContainerResources(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	backend, err := nodePool.BackendForContainer(containerID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
@@ -222,13 +285,14 @@ func editContainerResources(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	_, err = cli.ContainerUpdate(ctx, containerID, resources)
-	if err != nil {
+	if err := backend.Update(ctx, containerID, resources); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	containerInfo, err := cli.ContainerInspect(ctx, containerID)
+	nodePool.UpdateReservation(containerID, ram, cpu)
+
+	containerInfo, err := backend.Inspect(ctx, containerID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -259,14 +323,14 @@ func editContainerResources(w http.ResponseWriter, r *http.Request) {
 }
 
 func getContainerIPAddress(containerID string) (string, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	backend, err := nodePool.BackendForContainer(containerID)
 	if err != nil {
 		return "", err
 	}
 
 	ctx := context.Background()
 
-	containerInfo, err := cli.ContainerInspect(ctx, containerID)
+	containerInfo, err := backend.Inspect(ctx, containerID)
 	if err != nil {
 		return "", err
 	}
@@ -285,35 +349,39 @@ func getContainerIPAddress(containerID string) (string, error) {
 }
 
 func listContainers(w http.ResponseWriter, r *http.Request) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
 	ctx := context.Background()
 
-	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
-		All: true,
-	})
-	if err != nil {
-		http.Error(w, "Failed to list containers", http.StatusInternalServerError)
-		return
-	}
-
 	var containerInfo []struct {
-		ID    string   `json:"ID"`
-		Names []string `json:"Names"`
+		ID     string   `json:"ID"`
+		Names  []string `json:"Names"`
+		NodeID string   `json:"NodeID"`
 	}
 
-	for _, container := range containers {
-		containerInfo = append(containerInfo, struct {
-			ID    string   `json:"ID"`
-			Names []string `json:"Names"`
-		}{
-			ID:    container.ID,
-			Names: container.Names,
+	for _, node := range nodePool.ListNodes() {
+		backend, err := nodePool.BackendFor(node.ID)
+		if err != nil {
+			continue
+		}
+
+		containers, err := backend.List(ctx, types.ContainerListOptions{
+			All: true,
 		})
+		if err != nil {
+			http.Error(w, "Failed to list containers", http.StatusInternalServerError)
+			return
+		}
+
+		for _, container := range containers {
+			containerInfo = append(containerInfo, struct {
+				ID     string   `json:"ID"`
+				Names  []string `json:"Names"`
+				NodeID string   `json:"NodeID"`
+			}{
+				ID:     container.ID,
+				Names:  container.Names,
+				NodeID: node.ID,
+			})
+		}
 	}
 
 	responseJSON, err := json.Marshal(containerInfo)
@@ -340,9 +408,9 @@ func stopContainer(w http.ResponseWriter, r *http.Request) {
 	containerID := r.FormValue("containerID")
 	log.Println("Received containerID:", containerID)
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	backend, err := nodePool.BackendForContainer(containerID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
@@ -352,7 +420,7 @@ func stopContainer(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("Attempting to stop container with ID:", containerID)
 
-	if err := cli.ContainerStop(ctx, containerID, stopOptions); err != nil {
+	if err := backend.Stop(ctx, containerID, stopOptions); err != nil {
 		log.Println("Error stopping container:", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -378,7 +446,305 @@ func stopContainer(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func removeContainer(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	containerID := params["id"]
+
+	backend, err := nodePool.BackendForContainer(containerID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	removeOptions := types.ContainerRemoveOptions{
+		Force:         query.Get("force") == "true",
+		RemoveVolumes: query.Get("volumes") == "true",
+	}
+
+	if err := backend.Remove(context.Background(), containerID, removeOptions); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	nodePool.UnbindContainer(containerID)
+
+	response := struct {
+		Message string `json:"message"`
+	}{
+		Message: "Container removed successfully",
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(responseJSON); err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func restartContainer(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	containerID := params["id"]
+
+	backend, err := nodePool.BackendForContainer(containerID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	stopOptions := container.StopOptions{}
+	if tStr := r.URL.Query().Get("t"); tStr != "" {
+		timeout, err := strconv.Atoi(tStr)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid input for restart timeout")
+			return
+		}
+		stopOptions.Timeout = &timeout
+	}
+
+	if err := backend.Restart(context.Background(), containerID, stopOptions); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := struct {
+		Message string `json:"message"`
+	}{
+		Message: "Container restarted successfully",
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(responseJSON); err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func pauseContainer(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	containerID := params["id"]
+
+	backend, err := nodePool.BackendForContainer(containerID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err := backend.Pause(context.Background(), containerID); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := struct {
+		Message string `json:"message"`
+	}{
+		Message: "Container paused successfully",
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(responseJSON); err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func unpauseContainer(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	containerID := params["id"]
+
+	backend, err := nodePool.BackendForContainer(containerID)
+	if err != nil {
+		writeErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err := backend.Unpause(context.Background(), containerID); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := struct {
+		Message string `json:"message"`
+	}{
+		Message: "Container unpaused successfully",
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(responseJSON); err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+type NetworkStats struct {
+	RxBytes uint64 `json:"rx_bytes"`
+	TxBytes uint64 `json:"tx_bytes"`
+}
+
+type ContainerStatsSnapshot struct {
+	CPUPercent  float64                 `json:"cpu_percent"`
+	MemoryUsage uint64                  `json:"memory_usage"`
+	MemoryLimit uint64                  `json:"memory_limit"`
+	Networks    map[string]NetworkStats `json:"networks"`
+	BlkioRead   uint64                  `json:"blkio_read"`
+	BlkioWrite  uint64                  `json:"blkio_write"`
+}
+
+func computeCPUPercent(v *types.StatsJSON) float64 {
+	cpuDelta := float64(v.CPUStats.CPUUsage.TotalUsage) - float64(v.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(v.CPUStats.SystemUsage) - float64(v.PreCPUStats.SystemUsage)
+
+	onlineCPUs := float64(v.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(v.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	if systemDelta <= 0 || cpuDelta <= 0 {
+		return 0
+	}
+
+	return (cpuDelta / systemDelta) * onlineCPUs * 100.0
+}
+
+func buildStatsSnapshot(v *types.StatsJSON) ContainerStatsSnapshot {
+	networks := make(map[string]NetworkStats, len(v.Networks))
+	for name, net := range v.Networks {
+		networks[name] = NetworkStats{RxBytes: net.RxBytes, TxBytes: net.TxBytes}
+	}
+
+	var blkioRead, blkioWrite uint64
+	for _, entry := range v.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			blkioRead += entry.Value
+		case "write":
+			blkioWrite += entry.Value
+		}
+	}
+
+	return ContainerStatsSnapshot{
+		CPUPercent:  computeCPUPercent(v),
+		MemoryUsage: v.MemoryStats.Usage,
+		MemoryLimit: v.MemoryStats.Limit,
+		Networks:    networks,
+		BlkioRead:   blkioRead,
+		BlkioWrite:  blkioWrite,
+	}
+}
+
+func getContainerStats(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	containerID := params["id"]
+
+	stream := r.URL.Query().Get("stream") == "true"
+
+	backend, err := nodePool.BackendForContainer(containerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+
+	stats, err := backend.Stats(ctx, containerID, stream)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer stats.Body.Close()
+
+	decoder := json.NewDecoder(stats.Body)
+
+	if !stream {
+		var v types.StatsJSON
+		if err := decoder.Decode(&v); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseJSON, err := json.Marshal(buildStatsSnapshot(&v))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(responseJSON)
+		if err != nil {
+			log.Println("Failed to write response:", err)
+		}
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		var v types.StatsJSON
+		if err := decoder.Decode(&v); err != nil {
+			if err != io.EOF {
+				log.Println("Failed to decode container stats:", err)
+			}
+			return
+		}
+
+		line, err := json.Marshal(buildStatsSnapshot(&v))
+		if err != nil {
+			log.Println("Failed to marshal stats snapshot:", err)
+			return
+		}
+
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			log.Println("Failed to write stats snapshot:", err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
 func main() {
+	flag.Parse()
+	if *backendFlag != "" {
+		backendKind = *backendFlag
+	}
+
 	router := mux.NewRouter()
 
 	// Serve HTML page and static assets
@@ -389,9 +755,24 @@ func main() {
 
 	router.HandleFunc("/containers", createDockerContainer).Methods("POST")
 	router.HandleFunc("/containers/{id}/resources", getContainerResources).Methods("GET")
+	router.HandleFunc("/containers/{id}/stats", getContainerStats).Methods("GET")
 	router.HandleFunc("/containers/{id}/resources", editContainerResources).Methods("PUT")
 	router.HandleFunc("/containers/stop", stopContainer).Methods("POST")
 	router.HandleFunc("/containers", listContainers).Methods("GET") // New route to list containers
+	router.HandleFunc("/containers/{id}", removeContainer).Methods("DELETE")
+	router.HandleFunc("/containers/{id}/restart", restartContainer).Methods("POST")
+	router.HandleFunc("/containers/{id}/pause", pauseContainer).Methods("POST")
+	router.HandleFunc("/containers/{id}/unpause", unpauseContainer).Methods("POST")
+
+	router.HandleFunc("/nodes", registerNode).Methods("POST")
+	router.HandleFunc("/nodes", listNodes).Methods("GET")
+	router.HandleFunc("/nodes/{id}", deleteNode).Methods("DELETE")
+
+	router.HandleFunc("/events", streamEvents).Methods("GET")
+
+	router.HandleFunc("/images/build", buildImage).Methods("POST")
+	router.HandleFunc("/images/pull", pullImage).Methods("POST")
+	router.HandleFunc("/images", listImages).Methods("GET")
 
 	log.Println("Server started on http://localhost:8080")
 	log.Fatal(http.ListenAndServe(":8080", router))